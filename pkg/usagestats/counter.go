@@ -0,0 +1,30 @@
+package usagestats
+
+import "sync/atomic"
+
+// Counter is a simple monotonically increasing named value that gets folded
+// into the usage report payload on every report interval. Callers obtain one
+// via RegisterCounter rather than constructing it directly, so that counters
+// registered under the same name from different subsystems share state.
+type Counter struct {
+	name  string
+	value int64
+}
+
+// NewCounter creates a standalone named Counter. Prefer RegisterCounter,
+// which dedupes by name against the package-global registry.
+func NewCounter(name string) *Counter {
+	return &Counter{name: name}
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add increments the counter by delta.
+func (c *Counter) Add(delta int64) { atomic.AddInt64(&c.value, delta) }
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() int64 { return atomic.LoadInt64(&c.value) }
+
+// Name returns the name the counter was registered under.
+func (c *Counter) Name() string { return c.name }
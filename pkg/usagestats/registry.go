@@ -0,0 +1,195 @@
+package usagestats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventStats accumulates phase-tagged event observations - a success/error
+// outcome and an optional duration - over a single reporting window.
+type eventStats struct {
+	mtx sync.Mutex
+
+	count  int64
+	errors int64
+	minDur time.Duration
+	maxDur time.Duration
+	sumDur time.Duration
+}
+
+// Record accumulates a single observation of the event. success reports the
+// outcome and duration is optional - zero means it wasn't measured. Record
+// is exported so that callers who cached the value returned by RegisterEvent
+// - ingester, distributor, querier, compactor - can record observations
+// directly against it instead of going through the package-level Record
+// lookup on every call.
+func (e *eventStats) Record(success bool, duration time.Duration) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.count++
+	if !success {
+		e.errors++
+	}
+	if duration <= 0 {
+		return
+	}
+	if e.minDur == 0 || duration < e.minDur {
+		e.minDur = duration
+	}
+	if duration > e.maxDur {
+		e.maxDur = duration
+	}
+	e.sumDur += duration
+}
+
+// EventSummary is the aggregated min/max/avg/count view of a phase event
+// over a report window, ready to be embedded in the usage report payload.
+type EventSummary struct {
+	Phase  string        `json:"phase"`
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"`
+	MinDur time.Duration `json:"minDuration"`
+	MaxDur time.Duration `json:"maxDuration"`
+	AvgDur time.Duration `json:"avgDuration"`
+}
+
+func (e *eventStats) summary(phase string) EventSummary {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	s := EventSummary{
+		Phase:  phase,
+		Count:  e.count,
+		Errors: e.errors,
+		MinDur: e.minDur,
+		MaxDur: e.maxDur,
+	}
+	if e.count > 0 {
+		s.AvgDur = e.sumDur / time.Duration(e.count)
+	}
+	return s
+}
+
+// reset clears the window so the next report interval starts from zero.
+func (e *eventStats) reset() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.count, e.errors, e.minDur, e.maxDur, e.sumDur = 0, 0, 0, 0, 0
+}
+
+// Stats is a snapshot of every registered counter and event, taken once per
+// report interval and embedded in the payload sent by Reporter.reportUsage.
+type Stats struct {
+	Counters map[string]int64         `json:"counters,omitempty"`
+	Events   []EventSummary           `json:"events,omitempty"`
+	Tenants  map[string]TenantSummary `json:"tenants,omitempty"`
+}
+
+type statsRegistry struct {
+	mtx      sync.RWMutex
+	counters map[string]*Counter
+	events   map[string]*eventStats
+}
+
+var registry = &statsRegistry{
+	counters: map[string]*Counter{},
+	events:   map[string]*eventStats{},
+}
+
+// disabled mirrors Config.Disabled so the package-level RegisterCounter,
+// RegisterEvent and Record helpers become no-ops without every caller having
+// to thread a *Reporter through. NewReporter flips it whenever it returns a
+// nil Reporter.
+var disabled int32
+
+func setDisabled(v bool) {
+	val := int32(0)
+	if v {
+		val = 1
+	}
+	atomic.StoreInt32(&disabled, val)
+}
+
+func isDisabled() bool { return atomic.LoadInt32(&disabled) == 1 }
+
+// RegisterCounter registers, or fetches if already registered, a named
+// counter that callers can use to accumulate a running total for the
+// lifetime of the process. It is a no-op, returning a throwaway Counter,
+// when usage reporting is disabled.
+func RegisterCounter(name string) *Counter {
+	if isDisabled() {
+		return NewCounter(name)
+	}
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+	if c, ok := registry.counters[name]; ok {
+		return c
+	}
+	c := NewCounter(name)
+	registry.counters[name] = c
+	return c
+}
+
+// RegisterEvent registers, or fetches if already registered, a named "phase"
+// event, e.g. ingester.flush, querier.query, compactor.compact. It is a
+// no-op, returning a throwaway aggregator, when usage reporting is disabled.
+func RegisterEvent(name string) *eventStats {
+	if isDisabled() {
+		return &eventStats{}
+	}
+	registry.mtx.Lock()
+	defer registry.mtx.Unlock()
+	if e, ok := registry.events[name]; ok {
+		return e
+	}
+	e := &eventStats{}
+	registry.events[name] = e
+	return e
+}
+
+// Record accumulates a single observation of the named phase event. success
+// reports the outcome and duration is optional - zero means it wasn't
+// measured. Record is a no-op when usage reporting is disabled.
+func Record(name string, success bool, duration time.Duration) {
+	if isDisabled() {
+		return
+	}
+	RegisterEvent(name).Record(success, duration)
+}
+
+// snapshot returns the current value of every registered counter, event and
+// tenant without resetting anything, so a report that some sink has not yet
+// confirmed leaves the window intact; Reporter.reportUsage retries such a
+// report with its cached body rather than a new snapshot. Call resetWindow
+// once a report built from this snapshot has actually been sent
+// successfully. tenantCardinalityLimit and reservedTenant bound and shape
+// the tenant rollup, see tenantSnapshot.
+func snapshot(tenantCardinalityLimit int, reservedTenant string) Stats {
+	registry.mtx.RLock()
+	counters := make(map[string]int64, len(registry.counters))
+	for name, c := range registry.counters {
+		counters[name] = c.Value()
+	}
+	events := make([]EventSummary, 0, len(registry.events))
+	for phase, e := range registry.events {
+		events = append(events, e.summary(phase))
+	}
+	registry.mtx.RUnlock()
+
+	return Stats{Counters: counters, Events: events, Tenants: tenantSnapshot(tenantCardinalityLimit, reservedTenant)}
+}
+
+// resetWindow clears event and tenant aggregates so the next report
+// interval starts from zero. It must only be called once a report built
+// from snapshot has been sent successfully; counters are cumulative and are
+// never reset.
+func resetWindow() {
+	registry.mtx.RLock()
+	for _, e := range registry.events {
+		e.reset()
+	}
+	registry.mtx.RUnlock()
+	resetTenants()
+}
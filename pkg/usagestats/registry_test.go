@@ -0,0 +1,73 @@
+package usagestats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotDoesNotResetUntilWindowCleared(t *testing.T) {
+	registry.counters = map[string]*Counter{}
+	registry.events = map[string]*eventStats{}
+	tenantStats.tenants = map[string]*TenantActivity{}
+	defer func() {
+		registry.counters = map[string]*Counter{}
+		registry.events = map[string]*eventStats{}
+		tenantStats.tenants = map[string]*TenantActivity{}
+	}()
+
+	RegisterCounter("test_counter").Add(5)
+	RegisterEvent("test_phase").Record(true, time.Second)
+	RecordTenantActivity("tenant-a", TenantActivity{BytesIngested: 100})
+
+	// Simulate a failed send: taking a snapshot must not clear anything, so
+	// the next attempt retries with the same data instead of losing it.
+	first := snapshot(0, "")
+	if first.Counters["test_counter"] != 5 {
+		t.Fatalf("counter = %d, want 5", first.Counters["test_counter"])
+	}
+	if len(first.Events) != 1 || first.Events[0].Count != 1 {
+		t.Fatalf("events = %+v, want one event with count 1", first.Events)
+	}
+	if first.Tenants["tenant-a"].BytesIngested != 100 {
+		t.Fatalf("tenant bytes = %d, want 100", first.Tenants["tenant-a"].BytesIngested)
+	}
+
+	second := snapshot(0, "")
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("snapshot must be idempotent until resetWindow is called: %+v != %+v", first, second)
+	}
+
+	// Only once the send is confirmed successful does the window clear.
+	resetWindow()
+
+	third := snapshot(0, "")
+	if third.Counters["test_counter"] != 5 {
+		t.Fatalf("counters are cumulative and must never reset, got %d", third.Counters["test_counter"])
+	}
+	// Events stay registered, so cached handles keep working, but their
+	// window aggregates are zeroed.
+	if len(third.Events) != 1 || third.Events[0].Count != 0 {
+		t.Fatalf("events must stay registered with a zeroed window after resetWindow, got %+v", third.Events)
+	}
+	if len(third.Tenants) != 0 {
+		t.Fatalf("tenants must be cleared after resetWindow, got %+v", third.Tenants)
+	}
+}
+
+func TestRegisterEventReturnsHandleWithExportedRecord(t *testing.T) {
+	registry.events = map[string]*eventStats{}
+	defer func() { registry.events = map[string]*eventStats{} }()
+
+	// Callers such as the ingester or querier are expected to cache the
+	// value returned by RegisterEvent once and call Record on it directly,
+	// rather than going through the package-level Record lookup every time.
+	handle := RegisterEvent("cached_phase")
+	handle.Record(true, 0)
+	handle.Record(false, 0)
+
+	s := handle.summary("cached_phase")
+	if s.Count != 2 || s.Errors != 1 {
+		t.Fatalf("summary = %+v, want Count=2 Errors=1", s)
+	}
+}
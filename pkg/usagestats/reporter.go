@@ -6,12 +6,16 @@ import (
 	"flag"
 	"io"
 	"math"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/google/uuid"
 	"github.com/grafana/dskit/backoff"
+	dskit_tls "github.com/grafana/dskit/crypto/tls"
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/multierror"
 	"github.com/grafana/dskit/services"
@@ -33,32 +37,84 @@ const (
 var (
 	reportCheckInterval = time.Minute
 	reportInterval      = 1 * time.Hour
+
+	// sinkSendBackoff is sendToSink's retry policy, broken out as a var
+	// rather than an inline literal so tests can shrink it instead of
+	// waiting out real backoff delays.
+	sinkSendBackoff = backoff.Config{
+		MinBackoff: time.Second,
+		MaxBackoff: 30 * time.Second,
+		MaxRetries: 5,
+	}
 )
 
 type Config struct {
 	Disabled bool `yaml:"disabled"`
 	Leader   bool `yaml:"-"`
+
+	Sink SinkConfig `yaml:"sink"`
+
+	// ClusterIDSalt feeds the deterministic, ephemeral cluster seed that is
+	// synthesized when object storage stays unreachable for too long. It has
+	// no effect once a real seed has been read or written.
+	ClusterIDSalt string `yaml:"cluster_id_salt"`
+
+	// ReservedTenant is the tenant ID reserved for cluster-wide,
+	// non-tenant-attributable aggregates recorded via RecordTenantActivity;
+	// the per-tenant rollup never folds it into the "__other" bucket. This
+	// package does not reject pushes or queries under this ID.
+	ReservedTenant string `yaml:"reserved_tenant"`
+	// TenantCardinalityLimit bounds how many tenants are reported
+	// individually in the per-tenant rollup; the rest are collapsed into an
+	// "__other" bucket.
+	TenantCardinalityLimit int `yaml:"tenant_cardinality_limit"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.Disabled, "usage-report.disabled", false, "Disable anonymous usage reporting.")
+	f.StringVar(&cfg.ClusterIDSalt, "usage-report.cluster-id-salt", "", "Salt mixed into the deterministic cluster ID synthesized when object storage is unreachable for too long. Only used as a fallback; has no effect once a real cluster seed exists.")
+	f.StringVar(&cfg.ReservedTenant, "usage-report.reserved-tenant", DefaultReservedTenant, "Tenant ID reserved for cluster-wide usage aggregates. It is never collapsed into the __other bucket of the per-tenant usage rollup. This setting does not reject pushes or queries under this tenant.")
+	f.IntVar(&cfg.TenantCardinalityLimit, "usage-report.tenant-cardinality-limit", 2000, "Maximum number of tenants reported individually in the per-tenant usage rollup; the long tail beyond this is collapsed into an __other bucket.")
+	cfg.Sink.RegisterFlags(f)
 }
 
 type Reporter struct {
 	kvClient     kv.Client
+	hashKVClient kv.Client
 	logger       log.Logger
 	objectClient chunk.ObjectClient
 	reg          prometheus.Registerer
 
 	services.Service
 
-	conf       Config
-	cluster    *ClusterSeed
-	lastReport time.Time
+	conf        Config
+	cluster     atomic.Pointer[ClusterSeed]
+	lastReport  time.Time
+	sinks       []ReportSink
+	seedChecker *SeedChecker
+
+	// pendingInterval, pendingBody and pendingSinks track an in-flight
+	// report across ticks of running's loop: pendingSinks holds only the
+	// sinks that haven't yet confirmed pendingBody for pendingInterval, so a
+	// sink that's down doesn't get retried with a growing window and a sink
+	// that already succeeded never gets the same body resent. All three are
+	// only written from the single goroutine running reportUsage.
+	pendingInterval time.Time
+	pendingBody     []byte
+	pendingSinks    map[string]ReportSink
 }
 
+// getCluster returns the current cluster seed. It's safe to call
+// concurrently with setCluster, which resyncSeed does from the SeedChecker
+// goroutine while running's ticker loop reads the seed to schedule and build
+// reports.
+func (rep *Reporter) getCluster() *ClusterSeed { return rep.cluster.Load() }
+
+func (rep *Reporter) setCluster(seed *ClusterSeed) { rep.cluster.Store(seed) }
+
 func NewReporter(config Config, kvConfig kv.Config, objectClient chunk.ObjectClient, logger log.Logger, reg prometheus.Registerer) (*Reporter, error) {
+	setDisabled(config.Disabled)
 	if config.Disabled {
 		return nil, nil
 	}
@@ -66,18 +122,61 @@ func NewReporter(config Config, kvConfig kv.Config, objectClient chunk.ObjectCli
 	if err != nil {
 		return nil, err
 	}
+	// hashKVClient shares the same backend as kvClient but uses hashCodec,
+	// since the seed hashes and resync requests SeedChecker exchanges are
+	// plain strings rather than ClusterSeed values.
+	hashKVClient, err := kv.NewClient(kvConfig, hashCodec{}, kv.RegistererWithKVName(reg, "usagestats-seed-check"), logger)
+	if err != nil {
+		return nil, err
+	}
+	sinks, err := buildSinks(config.Sink)
+	if err != nil {
+		return nil, err
+	}
 	r := &Reporter{
 		kvClient:     kvClient,
+		hashKVClient: hashKVClient,
 		logger:       logger,
 		objectClient: objectClient,
 		conf:         config,
 		reg:          reg,
+		sinks:        sinks,
+	}
+	instanceID, err := os.Hostname()
+	if err != nil {
+		instanceID = uuid.NewString()
 	}
+	r.seedChecker = NewSeedChecker(r, instanceID, reportCheckInterval, reg)
 	r.Service = services.NewBasicService(nil, r.running, nil)
 	return r, nil
 }
 
+// buildSinks always registers the default grafana.com sink, and adds an
+// operator-configured one on top of it when SinkConfig.Endpoint is set, so
+// air-gapped operators can keep telemetry on-prem instead of disabling it
+// entirely.
+func buildSinks(cfg SinkConfig) ([]ReportSink, error) {
+	grafanaSink, err := newHTTPSink("grafana.com", reportURL, "", dskit_tls.ClientConfig{}, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	sinks := []ReportSink{grafanaSink}
+
+	if cfg.Endpoint != "" {
+		operatorSink, err := newHTTPSink("operator", cfg.Endpoint, cfg.ProxyURL, cfg.TLS, cfg.Headers, cfg.SharedSecret)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, operatorSink)
+	}
+	return sinks, nil
+}
+
 func (rep *Reporter) initLeader(ctx context.Context) *ClusterSeed {
+	// writeFailures counts writeSeedFile failures; once more than
+	// fallbackSeedAttempts writes have failed, we stop blocking and
+	// synthesize a local, ephemeral seed instead.
+	writeFailures := 0
 	// Try to become leader via the kv client
 	for backoff := backoff.New(ctx, backoff.Config{
 		MinBackoff: time.Second,
@@ -103,36 +202,73 @@ func (rep *Reporter) initLeader(ctx context.Context) *ClusterSeed {
 			level.Info(rep.logger).Log("msg", "failed to CAS cluster seed key", "err", err)
 			continue
 		}
-		// Fetch the remote cluster seed.
+		// Fetch the remote cluster seed. otherErrCount bounds how many times
+		// we retry a non-"not found" error inside fetchSeed before giving up
+		// on object storage for this attempt.
+		otherErrCount := 0
 		remoteSeed, err := rep.fetchSeed(ctx,
 			func(err error) bool {
-				// we only want to retry if the error is not an object not found error
-				return !rep.objectClient.IsObjectNotFoundErr(err)
+				if rep.objectClient.IsObjectNotFoundErr(err) {
+					return false
+				}
+				otherErrCount++
+				return otherErrCount <= fallbackSeedAttempts
 			})
 		if err != nil {
 			if rep.objectClient.IsObjectNotFoundErr(err) {
 				// we are the leader and we need to save the file.
 				if err := rep.writeSeedFile(ctx, seed); err != nil {
-					level.Info(rep.logger).Log("msg", "failed to CAS cluster seed key", "err", err)
+					level.Info(rep.logger).Log("msg", "failed to write cluster seed file", "err", err)
+					writeFailures++
+					if writeFailures > fallbackSeedAttempts {
+						return rep.fallbackSeed()
+					}
 					continue
 				}
 				return &seed
 			}
-			continue
+			// Object storage looks unreachable, not just momentarily erroring:
+			// fall back to a deterministic, ephemeral seed rather than
+			// blocking the leader forever.
+			return rep.fallbackSeed()
 		}
 		return remoteSeed
 	}
 }
 
+// fallbackSeed synthesizes and logs an ephemeral ClusterSeed. It is never
+// written to object storage, so it can never shadow a future authoritative
+// seed once object storage recovers.
+func (rep *Reporter) fallbackSeed() *ClusterSeed {
+	level.Warn(rep.logger).Log("msg", "object storage unavailable for too long, falling back to an ephemeral cluster seed")
+	seed := newEphemeralSeed(rep.conf.ClusterIDSalt)
+	return &seed
+}
+
 func (rep *Reporter) init(ctx context.Context) {
 	if rep.conf.Leader {
-		rep.cluster = rep.initLeader(ctx)
+		rep.setCluster(rep.initLeader(ctx))
 		return
 	}
-	// follower only wait for the cluster seed to be set.
-	// it will try forever to fetch the cluster seed.
-	seed, _ := rep.fetchSeed(ctx, nil)
-	rep.cluster = seed
+	// follower waits for the cluster seed to be set, but gives up on object
+	// storage and falls back to an ephemeral seed once more than
+	// fallbackSeedAttempts reads have failed rather than blocking forever. ObjectNotFoundErr is
+	// excluded from that budget, exactly like initLeader's own fetchSeed
+	// call: it's the expected, common case of a follower racing a leader
+	// that hasn't written the seed file yet, not object storage being
+	// unreachable.
+	otherErrCount := 0
+	seed, err := rep.fetchSeed(ctx, func(err error) bool {
+		if rep.objectClient.IsObjectNotFoundErr(err) {
+			return true
+		}
+		otherErrCount++
+		return otherErrCount <= fallbackSeedAttempts
+	})
+	if err != nil {
+		seed = rep.fallbackSeed()
+	}
+	rep.setCluster(seed)
 }
 
 // fetchSeed fetches the cluster seed from the object store and try until it succeeds.
@@ -207,12 +343,18 @@ func (rep *Reporter) writeSeedFile(ctx context.Context, seed ClusterSeed) error
 func (rep *Reporter) running(ctx context.Context) error {
 	rep.init(ctx)
 
+	go func() {
+		if err := rep.seedChecker.Run(ctx); err != nil && ctx.Err() == nil {
+			level.Warn(rep.logger).Log("msg", "seed checker stopped unexpectedly", "err", err)
+		}
+	}()
+
 	// check every minute if we should report.
 	ticker := time.NewTicker(reportCheckInterval)
 	defer ticker.Stop()
 
 	// find  when to send the next report.
-	next := nextReport(reportInterval, rep.cluster.CreatedAt, time.Now())
+	next := nextReport(reportInterval, rep.getCluster().CreatedAt, time.Now())
 	if rep.lastReport.IsZero() {
 		// if we never reported assumed it was the last interval.
 		rep.lastReport = next.Add(-reportInterval)
@@ -237,25 +379,85 @@ func (rep *Reporter) running(ctx context.Context) error {
 	}
 }
 
-// reportUsage reports the usage to grafana.com.
+// reportUsage fans the report for interval out to every configured
+// ReportSink independently, so a slow or unreachable sink cannot block the
+// others from receiving it. A sink is only sent interval's report until it
+// confirms it: as soon as it confirms the send it's dropped from pendingSinks and never
+// retried for interval again, so a sink that's merely slow to recover
+// doesn't keep re-receiving an ever-growing window, and a healthy sink isn't
+// hammered on every tick just because some other sink is down. The window
+// is reset, and the caller's report cadence may advance, only once every
+// sink has confirmed interval's report.
 func (rep *Reporter) reportUsage(ctx context.Context, interval time.Time) error {
-	backoff := backoff.New(ctx, backoff.Config{
-		MinBackoff: time.Second,
-		MaxBackoff: 30 * time.Second,
-		MaxRetries: 5,
-	})
-	var errs multierror.MultiError
-	for backoff.Ongoing() {
-		if err := sendReport(ctx, rep.cluster, interval); err != nil {
-			level.Info(rep.logger).Log("msg", "failed to send usage report", "retries", backoff.NumRetries(), "err", err)
-			errs.Add(err)
-			backoff.Wait()
+	if rep.pendingSinks == nil || !rep.pendingInterval.Equal(interval) {
+		body, err := buildReportBody(rep.getCluster(), interval, snapshot(rep.conf.TenantCardinalityLimit, rep.conf.ReservedTenant))
+		if err != nil {
+			return err
+		}
+		rep.pendingInterval = interval
+		rep.pendingBody = body
+		rep.pendingSinks = make(map[string]ReportSink, len(rep.sinks))
+		for _, sink := range rep.sinks {
+			rep.pendingSinks[sink.Name()] = sink
+		}
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(rep.pendingSinks))
+	var wg sync.WaitGroup
+	for name, sink := range rep.pendingSinks {
+		wg.Add(1)
+		go func(name string, sink ReportSink) {
+			defer wg.Done()
+			results <- result{name: name, err: rep.sendToSink(ctx, sink, rep.pendingBody)}
+		}(name, sink)
+	}
+	wg.Wait()
+	close(results)
+
+	var merr multierror.MultiError
+	for res := range results {
+		if res.err != nil {
+			merr.Add(res.err)
 			continue
 		}
-		level.Debug(rep.logger).Log("msg", "usage report sent with success")
+		delete(rep.pendingSinks, res.name)
+	}
+	if err := merr.Err(); err != nil {
+		return err
+	}
+
+	// Every sink has now confirmed interval's report: clear the window and
+	// the pending state so the next interval starts fresh.
+	resetWindow()
+	rep.pendingInterval = time.Time{}
+	rep.pendingBody = nil
+	rep.pendingSinks = nil
+	return nil
+}
+
+// sendToSink delivers body to sink, retrying with its own backoff so that
+// one sink's outage doesn't affect the retry budget of the others.
+func (rep *Reporter) sendToSink(ctx context.Context, sink ReportSink, body []byte) error {
+	bo := backoff.New(ctx, sinkSendBackoff)
+	var lastErr error
+	for bo.Ongoing() {
+		if err := sink.Send(ctx, body); err != nil {
+			level.Info(rep.logger).Log("msg", "failed to send usage report", "sink", sink.Name(), "retries", bo.NumRetries(), "err", err)
+			lastErr = err
+			bo.Wait()
+			continue
+		}
+		level.Debug(rep.logger).Log("msg", "usage report sent with success", "sink", sink.Name())
 		return nil
 	}
-	return errs.Err()
+	if lastErr != nil {
+		return lastErr
+	}
+	return bo.Err()
 }
 
 // nextReport compute the next report time based on the interval.
@@ -0,0 +1,174 @@
+package usagestats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/grafana/loki/pkg/storage/chunk"
+)
+
+// errObjectNotFound and errObjectOther stand in for the two error classes
+// fetchSeed's continueFn distinguishes: the former must never consume the
+// fallback-seed retry budget, the latter always does.
+var (
+	errObjectNotFound = errors.New("fake: object not found")
+	errObjectOther    = errors.New("fake: object storage unreachable")
+)
+
+// fakeObjectClient is a minimal chunk.ObjectClient that simulates a seed file
+// appearing in object storage after a configurable number of "not found"
+// reads, or an object storage outage when alwaysErr is set. It embeds
+// chunk.ObjectClient so only the methods fetchSeed actually exercises need
+// to be implemented.
+type fakeObjectClient struct {
+	chunk.ObjectClient
+
+	getObjectCalls int
+	notFoundUntil  int
+	alwaysErr      error
+}
+
+func (f *fakeObjectClient) GetObject(_ context.Context, _ string) (io.ReadCloser, int64, error) {
+	f.getObjectCalls++
+	if f.alwaysErr != nil {
+		return nil, 0, f.alwaysErr
+	}
+	if f.getObjectCalls <= f.notFoundUntil {
+		return nil, 0, errObjectNotFound
+	}
+	data, err := JSONCodec.Encode(ClusterSeed{UID: "leader-uid", CreatedAt: time.Now()})
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func (f *fakeObjectClient) DeleteObject(context.Context, string) error { return nil }
+
+func (f *fakeObjectClient) IsObjectNotFoundErr(err error) bool {
+	return errors.Is(err, errObjectNotFound)
+}
+
+// followerContinueFn mirrors the continueFn built by init()'s follower path.
+func followerContinueFn(rep *Reporter, otherErrCount *int) func(err error) bool {
+	return func(err error) bool {
+		if rep.objectClient.IsObjectNotFoundErr(err) {
+			return true
+		}
+		*otherErrCount++
+		return *otherErrCount <= fallbackSeedAttempts
+	}
+}
+
+func TestFollowerFetchSeedRetriesPastFallbackBudgetOnObjectNotFound(t *testing.T) {
+	client := &fakeObjectClient{notFoundUntil: fallbackSeedAttempts + 5}
+	rep := &Reporter{objectClient: client, logger: log.NewNopLogger()}
+
+	var otherErrCount int
+	seed, err := rep.fetchSeed(context.Background(), followerContinueFn(rep, &otherErrCount))
+	if err != nil {
+		t.Fatalf("fetchSeed() error = %v, want the follower to keep retrying ObjectNotFoundErr past fallbackSeedAttempts", err)
+	}
+	if seed.UID != "leader-uid" {
+		t.Fatalf("seed = %+v, want the leader's real seed rather than an ephemeral fallback", seed)
+	}
+	if client.getObjectCalls <= fallbackSeedAttempts {
+		t.Fatalf("GetObject called %d times, want more than fallbackSeedAttempts (%d); ObjectNotFoundErr must not consume the retry budget", client.getObjectCalls, fallbackSeedAttempts)
+	}
+}
+
+func TestFollowerFetchSeedGivesUpAfterFallbackBudgetOnOtherErrors(t *testing.T) {
+	client := &fakeObjectClient{alwaysErr: errObjectOther}
+	rep := &Reporter{objectClient: client, logger: log.NewNopLogger()}
+
+	var otherErrCount int
+	_, err := rep.fetchSeed(context.Background(), followerContinueFn(rep, &otherErrCount))
+	if err == nil {
+		t.Fatal("fetchSeed() error = nil, want the follower to give up after fallbackSeedAttempts consecutive non-ObjectNotFoundErr failures")
+	}
+}
+
+// fakeSink is a ReportSink test double whose Send fails until failUntil
+// calls have been made, then always succeeds, recording every body it's
+// asked to send.
+type fakeSink struct {
+	name      string
+	failUntil int
+
+	sendCalls int
+	bodies    [][]byte
+}
+
+func (f *fakeSink) Name() string { return f.name }
+
+func (f *fakeSink) Send(_ context.Context, body []byte) error {
+	f.sendCalls++
+	f.bodies = append(f.bodies, body)
+	if f.sendCalls <= f.failUntil {
+		return errors.New("fake: sink unreachable")
+	}
+	return nil
+}
+
+func TestReportUsageTracksSuccessPerSink(t *testing.T) {
+	// Shrink the sink backoff so the broken sink's internal retries inside
+	// sendToSink don't burn real wall-clock time.
+	orig := sinkSendBackoff
+	sinkSendBackoff.MinBackoff = time.Millisecond
+	sinkSendBackoff.MaxBackoff = time.Millisecond
+	defer func() { sinkSendBackoff = orig }()
+
+	registry.counters = map[string]*Counter{}
+	registry.events = map[string]*eventStats{}
+	defer func() {
+		registry.counters = map[string]*Counter{}
+		registry.events = map[string]*eventStats{}
+	}()
+	RegisterCounter("test_counter").Add(1)
+
+	healthy := &fakeSink{name: "grafana.com"}
+	// broken fails every attempt sendToSink makes on the first reportUsage
+	// call (MaxRetries: 5 means 5 total sends), then recovers.
+	broken := &fakeSink{name: "operator", failUntil: 6}
+	rep := &Reporter{logger: log.NewNopLogger(), sinks: []ReportSink{healthy, broken}}
+
+	interval := time.Now()
+	if err := rep.reportUsage(context.Background(), interval); err == nil {
+		t.Fatal("reportUsage() error = nil, want an error while the operator sink is still down")
+	}
+	if healthy.sendCalls != 1 {
+		t.Fatalf("healthy sink Send called %d times, want 1", healthy.sendCalls)
+	}
+	if _, stillPending := rep.pendingSinks[healthy.Name()]; stillPending {
+		t.Fatal("healthy sink must be dropped from pendingSinks once it confirms")
+	}
+	if _, stillPending := rep.pendingSinks[broken.Name()]; !stillPending {
+		t.Fatal("broken sink must remain in pendingSinks until it confirms")
+	}
+
+	// A second call for the SAME interval must not resend to the healthy
+	// sink, must reuse the cached body rather than rebuilding it from a
+	// larger window, and must finally succeed now that broken recovers.
+	broken.failUntil = 0
+	if err := rep.reportUsage(context.Background(), interval); err != nil {
+		t.Fatalf("reportUsage() error = %v, want nil once every sink has confirmed", err)
+	}
+	if healthy.sendCalls != 1 {
+		t.Fatalf("healthy sink Send called %d times across both calls, want 1 - it must never be resent an already-confirmed interval", healthy.sendCalls)
+	}
+	if !bytes.Equal(broken.bodies[0], broken.bodies[len(broken.bodies)-1]) {
+		t.Fatal("broken sink's retries must all see the same cached body, not a regenerated, growing window")
+	}
+	if rep.pendingSinks != nil {
+		t.Fatalf("pendingSinks = %v, want nil once every sink has confirmed", rep.pendingSinks)
+	}
+	if !rep.pendingInterval.IsZero() || rep.pendingBody != nil {
+		t.Fatal("pendingInterval and pendingBody must be cleared once every sink has confirmed")
+	}
+}
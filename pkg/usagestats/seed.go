@@ -0,0 +1,42 @@
+package usagestats
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ClusterSeed uniquely identifies a Loki cluster for anonymous usage
+// reporting purposes. It is created once, by whichever replica wins
+// leadership, and persisted to object storage so every replica reports
+// under the same identity.
+type ClusterSeed struct {
+	UID               string    `json:"UID"`
+	PrometheusVersion string    `json:"prometheusVersion"`
+	CreatedAt         time.Time `json:"createdAt"`
+
+	// Ephemeral is true when UID was synthesized locally instead of being
+	// read from, or written to, object storage, because the object store
+	// was unreachable for too long. Downstream analytics should treat
+	// ephemeral seeds as best-effort rather than authoritative.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+}
+
+type jsonCodec struct{}
+
+// JSONCodec encodes/decodes a ClusterSeed to/from JSON, used both for the kv
+// store leader election and the object storage seed file.
+var JSONCodec = jsonCodec{}
+
+func (jsonCodec) CodecID() string { return "usagestatsJSON" }
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	var seed ClusterSeed
+	if err := json.Unmarshal(data, &seed); err != nil {
+		return nil, err
+	}
+	return &seed, nil
+}
+
+func (jsonCodec) Encode(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
@@ -0,0 +1,164 @@
+package usagestats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// seedHashKeyPrefix namespaces the per-instance keys SeedChecker publishes
+// in the kv store, separate from seedKey which holds the seed itself.
+const seedHashKeyPrefix = "usagestats_seed_hash/"
+
+// resyncKeyPrefix namespaces the per-instance keys the leader writes to ask
+// a divergent replica to re-run fetchSeed.
+const resyncKeyPrefix = "usagestats_seed_resync/"
+
+// hashCodec is a minimal kv.Codec for the plain strings SeedChecker
+// publishes - a seed hash or a resync request - which, unlike ClusterSeed,
+// have no structured type to decode into.
+type hashCodec struct{}
+
+func (hashCodec) CodecID() string { return "usagestatsHashJSON" }
+
+func (hashCodec) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func (hashCodec) Encode(obj interface{}) ([]byte, error) {
+	s, _ := obj.(string)
+	return []byte(s), nil
+}
+
+// seedHash returns a short, stable hash of the fields of seed that must
+// agree across every replica: its UID, creation time and the version that
+// created it. Ephemeral is deliberately excluded, since a replica that fell
+// back to a local seed is expected to diverge until it catches up.
+func seedHash(seed *ClusterSeed) string {
+	if seed == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s", seed.UID, seed.CreatedAt.UnixNano(), seed.PrometheusVersion)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// SeedChecker periodically publishes this replica's view of the cluster
+// seed to the kv store and, on the leader, cross-checks every replica's
+// hash against its own to detect the race where writeSeedFile partially
+// succeeds and a follower's readSeedFile decodes stale-but-well-formed JSON
+// - corruption that today only heals after attemptNumber full read
+// failures.
+type SeedChecker struct {
+	rep        *Reporter
+	instanceID string
+	interval   time.Duration
+	logger     log.Logger
+
+	divergenceTotal prometheus.Counter
+}
+
+// NewSeedChecker builds a SeedChecker that publishes rep's cluster seed hash
+// under instanceID, and, when rep is the leader, watches for divergence
+// across replicas on every interval tick.
+func NewSeedChecker(rep *Reporter, instanceID string, interval time.Duration, reg prometheus.Registerer) *SeedChecker {
+	return &SeedChecker{
+		rep:        rep,
+		instanceID: instanceID,
+		interval:   interval,
+		logger:     rep.logger,
+		divergenceTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "loki_usagestats_seed_divergence_total",
+			Help: "Number of times the leader detected a replica publishing a cluster seed hash that diverges from its own.",
+		}),
+	}
+}
+
+// Run publishes, and on the leader cross-checks, the cluster seed hash on
+// every tick until ctx is done.
+func (c *SeedChecker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.tick(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *SeedChecker) tick(ctx context.Context) {
+	if c.resyncRequested(ctx) {
+		level.Warn(c.logger).Log("msg", "leader requested cluster seed resync, re-fetching")
+		c.rep.resyncSeed(ctx)
+	}
+
+	hashKey := seedHashKeyPrefix + c.instanceID
+	if err := c.rep.hashKVClient.CAS(ctx, hashKey, func(interface{}) (interface{}, bool, error) {
+		return seedHash(c.rep.getCluster()), true, nil
+	}); err != nil {
+		level.Warn(c.logger).Log("msg", "failed to publish cluster seed hash", "err", err)
+	}
+
+	if c.rep.conf.Leader {
+		c.checkDivergence(ctx)
+	}
+}
+
+func (c *SeedChecker) resyncRequested(ctx context.Context) bool {
+	v, err := c.rep.hashKVClient.Get(ctx, resyncKeyPrefix+c.instanceID)
+	if err != nil || v == nil {
+		return false
+	}
+	_ = c.rep.hashKVClient.Delete(ctx, resyncKeyPrefix+c.instanceID)
+	return true
+}
+
+func (c *SeedChecker) checkDivergence(ctx context.Context) {
+	leaderHash := seedHash(c.rep.getCluster())
+
+	keys, err := c.rep.hashKVClient.List(ctx, seedHashKeyPrefix)
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "failed to list cluster seed hashes", "err", err)
+		return
+	}
+	for _, key := range keys {
+		v, err := c.rep.hashKVClient.Get(ctx, key)
+		if err != nil {
+			level.Warn(c.logger).Log("msg", "failed to read cluster seed hash", "key", key, "err", err)
+			continue
+		}
+		replicaHash, _ := v.(string)
+		if replicaHash == "" || replicaHash == leaderHash {
+			continue
+		}
+		level.Warn(c.logger).Log("msg", "replica cluster seed diverges from leader", "key", key, "leaderHash", leaderHash, "replicaHash", replicaHash)
+		c.divergenceTotal.Inc()
+
+		instanceID := key[len(seedHashKeyPrefix):]
+		if err := c.rep.hashKVClient.CAS(ctx, resyncKeyPrefix+instanceID, func(interface{}) (interface{}, bool, error) {
+			return "1", true, nil
+		}); err != nil {
+			level.Warn(c.logger).Log("msg", "failed to request cluster seed resync", "key", key, "err", err)
+		}
+	}
+}
+
+// resyncSeed re-runs fetchSeed and swaps in the result, healing a replica
+// whose in-memory cluster seed was flagged as diverging from the leader's.
+func (rep *Reporter) resyncSeed(ctx context.Context) {
+	seed, err := rep.fetchSeed(ctx, nil)
+	if err != nil {
+		level.Warn(rep.logger).Log("msg", "failed to resync cluster seed", "err", err)
+		return
+	}
+	rep.setCluster(seed)
+}
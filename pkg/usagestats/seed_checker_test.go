@@ -0,0 +1,177 @@
+package usagestats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeKVClient is a minimal, in-memory kv.Client good enough to exercise
+// SeedChecker's CAS/Get/Delete/List usage without a real kv backend.
+type fakeKVClient struct {
+	mtx   sync.Mutex
+	store map[string]interface{}
+}
+
+func newFakeKVClient() *fakeKVClient { return &fakeKVClient{store: map[string]interface{}{}} }
+
+func (f *fakeKVClient) CAS(_ context.Context, key string, update func(in interface{}) (out interface{}, retry bool, err error)) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	out, _, err := update(f.store[key])
+	if err != nil {
+		return err
+	}
+	f.store[key] = out
+	return nil
+}
+
+func (f *fakeKVClient) Get(_ context.Context, key string) (interface{}, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.store[key], nil
+}
+
+func (f *fakeKVClient) Delete(_ context.Context, key string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.store, key)
+	return nil
+}
+
+func (f *fakeKVClient) List(_ context.Context, prefix string) ([]string, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var keys []string
+	for k := range f.store {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeKVClient) WatchKey(context.Context, string, func(interface{}) bool) {}
+
+func (f *fakeKVClient) WatchPrefix(context.Context, string, func(string, interface{}) bool) {}
+
+func TestSeedHash(t *testing.T) {
+	a := &ClusterSeed{UID: "uid-a", CreatedAt: time.Unix(100, 0), PrometheusVersion: "v1"}
+	b := &ClusterSeed{UID: "uid-a", CreatedAt: time.Unix(100, 0), PrometheusVersion: "v1"}
+	if seedHash(a) != seedHash(b) {
+		t.Fatalf("seedHash must agree for equal seeds: %q != %q", seedHash(a), seedHash(b))
+	}
+
+	// Ephemeral is deliberately excluded from the hash.
+	eph := &ClusterSeed{UID: "uid-a", CreatedAt: time.Unix(100, 0), PrometheusVersion: "v1", Ephemeral: true}
+	if seedHash(a) != seedHash(eph) {
+		t.Fatalf("seedHash must ignore Ephemeral: %q != %q", seedHash(a), seedHash(eph))
+	}
+
+	diff := &ClusterSeed{UID: "uid-b", CreatedAt: time.Unix(100, 0), PrometheusVersion: "v1"}
+	if seedHash(a) == seedHash(diff) {
+		t.Fatal("seedHash must differ for a different UID")
+	}
+
+	if seedHash(nil) != "" {
+		t.Fatalf("seedHash(nil) = %q, want empty string", seedHash(nil))
+	}
+}
+
+func newTestSeedChecker(rep *Reporter, instanceID string) *SeedChecker {
+	return NewSeedChecker(rep, instanceID, time.Minute, prometheus.NewRegistry())
+}
+
+func TestSeedCheckerTickPublishesOwnHash(t *testing.T) {
+	rep := &Reporter{hashKVClient: newFakeKVClient(), logger: log.NewNopLogger(), conf: Config{Leader: false}}
+	rep.setCluster(&ClusterSeed{UID: "replica-uid", CreatedAt: time.Unix(200, 0)})
+	c := newTestSeedChecker(rep, "replica-1")
+
+	c.tick(context.Background())
+
+	got, err := rep.hashKVClient.Get(context.Background(), seedHashKeyPrefix+"replica-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got != seedHash(rep.getCluster()) {
+		t.Fatalf("published hash = %v, want %v", got, seedHash(rep.getCluster()))
+	}
+}
+
+func TestSeedCheckerCheckDivergenceRequestsResync(t *testing.T) {
+	kv := newFakeKVClient()
+	rep := &Reporter{hashKVClient: kv, logger: log.NewNopLogger(), conf: Config{Leader: true}}
+	rep.setCluster(&ClusterSeed{UID: "leader-uid", CreatedAt: time.Unix(300, 0)})
+	c := newTestSeedChecker(rep, "leader")
+
+	// A divergent replica publishes a hash that disagrees with the leader's.
+	if err := kv.CAS(context.Background(), seedHashKeyPrefix+"replica-1", func(interface{}) (interface{}, bool, error) {
+		return "divergent-hash", true, nil
+	}); err != nil {
+		t.Fatalf("CAS() error = %v", err)
+	}
+
+	c.checkDivergence(context.Background())
+
+	v, err := kv.Get(context.Background(), resyncKeyPrefix+"replica-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if v == nil {
+		t.Fatal("checkDivergence did not request a resync for the diverging replica")
+	}
+}
+
+func TestSeedCheckerResyncRequested(t *testing.T) {
+	kv := newFakeKVClient()
+	rep := &Reporter{hashKVClient: kv, logger: log.NewNopLogger()}
+	c := newTestSeedChecker(rep, "replica-1")
+
+	if c.resyncRequested(context.Background()) {
+		t.Fatal("resyncRequested() = true before any resync was requested")
+	}
+
+	if err := kv.CAS(context.Background(), resyncKeyPrefix+"replica-1", func(interface{}) (interface{}, bool, error) {
+		return "1", true, nil
+	}); err != nil {
+		t.Fatalf("CAS() error = %v", err)
+	}
+
+	if !c.resyncRequested(context.Background()) {
+		t.Fatal("resyncRequested() = false after a resync was requested")
+	}
+	// resyncRequested consumes the request so it isn't re-applied on the next tick.
+	if c.resyncRequested(context.Background()) {
+		t.Fatal("resyncRequested() must delete the key once consumed")
+	}
+}
+
+// TestReporterClusterAccessIsRaceFree exercises the exact concurrency pattern
+// that motivated the atomic.Pointer change: resyncSeed writing the cluster
+// seed from the SeedChecker goroutine while running's ticker loop
+// concurrently reads it. Run with -race to catch a regression.
+func TestReporterClusterAccessIsRaceFree(t *testing.T) {
+	rep := &Reporter{}
+	rep.setCluster(&ClusterSeed{UID: "initial"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		i := i
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rep.setCluster(&ClusterSeed{UID: fmt.Sprintf("seed-%d", i)})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = rep.getCluster().UID
+		}()
+	}
+	wg.Wait()
+}
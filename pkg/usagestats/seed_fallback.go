@@ -0,0 +1,70 @@
+package usagestats
+
+import (
+	"crypto/sha256"
+	"net"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/grafana/loki/pkg/util/build"
+)
+
+// fallbackSeedAttempts is how many consecutive fetchSeed/writeSeedFile
+// failures initLeader tolerates before giving up on object storage and
+// synthesizing a local, ephemeral cluster seed instead of blocking forever.
+const fallbackSeedAttempts = 10
+
+// newEphemeralSeed synthesizes a deterministic, best-effort ClusterSeed when
+// object storage is unreachable. The UID is derived from stable local
+// inputs - hostname, an operator-provided salt and the first discovered MAC
+// address - hashed into UUIDv4 form, so repeated synthesis on the same host
+// (e.g. across restarts before a real seed is ever written) is idempotent.
+// The resulting seed is never written to object storage and is flagged
+// Ephemeral so it can never overwrite a future authoritative seed.
+func newEphemeralSeed(salt string) ClusterSeed {
+	return ClusterSeed{
+		UID:               ephemeralUID(salt),
+		PrometheusVersion: build.GetVersion(),
+		CreatedAt:         time.Now(),
+		Ephemeral:         true,
+	}
+}
+
+func ephemeralUID(salt string) string {
+	hostname, _ := os.Hostname()
+	sum := sha256.Sum256([]byte(hostname + "|" + salt + "|" + firstMACAddress()))
+	id, err := uuid.FromBytes(toUUIDv4(sum[:16]))
+	if err != nil {
+		// sum is always sliced to exactly 16 bytes, so this can't happen;
+		// fall back to a random UID rather than propagating the error.
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// toUUIDv4 stamps the version/variant bits required for a well-formed UUIDv4
+// onto an arbitrary 16-byte digest.
+func toUUIDv4(b []byte) []byte {
+	out := make([]byte, 16)
+	copy(out, b)
+	out[6] = (out[6] & 0x0f) | 0x40
+	out[8] = (out[8] & 0x3f) | 0x80
+	return out
+}
+
+// firstMACAddress returns the hardware address of the first network
+// interface that has one, or "" if none is found.
+func firstMACAddress() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range ifaces {
+		if len(iface.HardwareAddr) > 0 {
+			return iface.HardwareAddr.String()
+		}
+	}
+	return ""
+}
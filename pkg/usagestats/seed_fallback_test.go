@@ -0,0 +1,34 @@
+package usagestats
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEphemeralUIDIsDeterministic(t *testing.T) {
+	a := ephemeralUID("salt-a")
+	b := ephemeralUID("salt-a")
+	if a != b {
+		t.Fatalf("ephemeralUID(%q) = %q, then %q; want deterministic output for the same inputs", "salt-a", a, b)
+	}
+
+	if _, err := uuid.Parse(a); err != nil {
+		t.Fatalf("ephemeralUID(%q) = %q is not a valid UUID: %v", "salt-a", a, err)
+	}
+
+	other := ephemeralUID("salt-b")
+	if other == a {
+		t.Fatalf("ephemeralUID with different salts produced the same UID %q", a)
+	}
+}
+
+func TestNewEphemeralSeedIsFlaggedEphemeral(t *testing.T) {
+	seed := newEphemeralSeed("salt")
+	if !seed.Ephemeral {
+		t.Fatal("newEphemeralSeed() seed must be flagged Ephemeral")
+	}
+	if seed.UID == "" {
+		t.Fatal("newEphemeralSeed() seed must have a UID")
+	}
+}
@@ -0,0 +1,167 @@
+package usagestats
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	dskit_tls "github.com/grafana/dskit/crypto/tls"
+)
+
+// reportURL is the default, always-registered sink: Grafana Labs' own
+// collector.
+const reportURL = "https://stats.grafana.org/loki-usage-report"
+
+// signatureHeader carries the HMAC-SHA256 signature of the JSON body, when a
+// shared secret is configured for a sink.
+const signatureHeader = "X-Loki-Signature"
+
+// ReportSink delivers an already-built usage report payload somewhere.
+// Reporter.reportUsage fans the same payload out to every registered sink
+// independently, so a slow or unreachable sink can't block the others.
+type ReportSink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Send delivers body, the JSON-encoded report.
+	Send(ctx context.Context, body []byte) error
+}
+
+// headerFlag implements flag.Value to allow -usage-report.headers to be
+// passed multiple times, each in "key:value" form. It holds a pointer to the
+// destination map, rather than one of its own, so Set's mutations land in
+// the SinkConfig that registered it instead of a throwaway copy.
+type headerFlag struct {
+	headers *map[string]string
+}
+
+func (h *headerFlag) String() string {
+	if h == nil || h.headers == nil || len(*h.headers) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(*h.headers))
+	for k, v := range *h.headers {
+		parts = append(parts, k+":"+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (h *headerFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("invalid header %q, expected key:value", value)
+	}
+	if *h.headers == nil {
+		*h.headers = map[string]string{}
+	}
+	(*h.headers)[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	return nil
+}
+
+// SinkConfig configures an additional, operator-owned ReportSink alongside
+// the default grafana.com one. It is left with a zero-value Endpoint by
+// default, which means no additional sink is registered.
+type SinkConfig struct {
+	Endpoint     string                 `yaml:"endpoint"`
+	ProxyURL     string                 `yaml:"proxy_url"`
+	TLS          dskit_tls.ClientConfig `yaml:"tls"`
+	Headers      map[string]string      `yaml:"headers"`
+	SharedSecret string                 `yaml:"shared_secret"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *SinkConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Endpoint, "usage-report.endpoint", "", "Additional endpoint to send the anonymous usage report to, on top of the default Grafana Labs collector. Leave empty to disable.")
+	f.StringVar(&cfg.ProxyURL, "usage-report.proxy-url", "", "HTTP(S) proxy to use when sending the usage report to the configured endpoint.")
+	f.StringVar(&cfg.SharedSecret, "usage-report.shared-secret", "", "Shared secret used to sign the usage report payload sent to the configured endpoint with HMAC-SHA256, carried in the X-Loki-Signature header. Leave empty to disable signing.")
+	f.Var(&headerFlag{headers: &cfg.Headers}, "usage-report.headers", "HTTP header to add to the usage report request sent to the configured endpoint, in the form key:value. Can be passed multiple times.")
+	cfg.TLS.RegisterFlagsWithPrefix("usage-report.tls", f)
+}
+
+// httpSink is a ReportSink that POSTs the report body to an HTTP(S)
+// endpoint, optionally through a proxy, with custom TLS, extra headers and
+// an HMAC signature.
+type httpSink struct {
+	name         string
+	endpoint     string
+	client       *http.Client
+	headers      map[string]string
+	sharedSecret string
+}
+
+// newHTTPSink builds a ReportSink for endpoint. tlsCfg may be the zero value,
+// in which case the default TLS settings are used.
+func newHTTPSink(name, endpoint, proxyURL string, tlsCfg dskit_tls.ClientConfig, headers map[string]string, sharedSecret string) (*httpSink, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		parsed, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url for usage-report sink %q: %w", name, err)
+		}
+		transport.Proxy = http.ProxyURL(parsed)
+	}
+	tlsConfig, err := tlsCfg.GetTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS config for usage-report sink %q: %w", name, err)
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &httpSink{
+		name:         name,
+		endpoint:     endpoint,
+		client:       &http.Client{Transport: transport, Timeout: 5 * time.Second},
+		headers:      headers,
+		sharedSecret: sharedSecret,
+	}, nil
+}
+
+func (s *httpSink) Name() string { return s.name }
+
+func (s *httpSink) Send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if s.sharedSecret != "" {
+		mac := hmac.New(sha256.New, []byte(s.sharedSecret))
+		mac.Write(body)
+		req.Header.Set(signatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("usage-report sink %q: unexpected status code %d", s.name, resp.StatusCode)
+	}
+	return nil
+}
+
+// reportPayload is the JSON body POSTed to every configured ReportSink.
+type reportPayload struct {
+	*ClusterSeed
+	Interval time.Time `json:"interval"`
+	Stats    Stats     `json:"stats"`
+}
+
+func buildReportBody(cluster *ClusterSeed, interval time.Time, stats Stats) ([]byte, error) {
+	return json.Marshal(reportPayload{
+		ClusterSeed: cluster,
+		Interval:    interval,
+		Stats:       stats,
+	})
+}
@@ -0,0 +1,70 @@
+package usagestats
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dskit_tls "github.com/grafana/dskit/crypto/tls"
+)
+
+func TestHTTPSinkSignsBodyWhenSharedSecretConfigured(t *testing.T) {
+	const secret = "s3cret"
+	var gotSignature, gotHeader string
+	var gotBody []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(signatureHeader)
+		gotHeader = r.Header.Get("X-Extra")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink, err := newHTTPSink("operator", srv.URL, "", dskit_tls.ClientConfig{}, map[string]string{"X-Extra": "hello"}, secret)
+	if err != nil {
+		t.Fatalf("newHTTPSink() error = %v", err)
+	}
+
+	body := []byte(`{"stats":"payload"}`)
+	if err := sink.Send(context.Background(), body); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if gotHeader != "hello" {
+		t.Fatalf("X-Extra header = %q, want %q", gotHeader, "hello")
+	}
+	if string(gotBody) != string(body) {
+		t.Fatalf("body = %q, want %q", gotBody, body)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	want := hex.EncodeToString(mac.Sum(nil))
+	if gotSignature != want {
+		t.Fatalf("signature = %q, want %q", gotSignature, want)
+	}
+}
+
+func TestHeaderFlagWritesBackIntoSinkConfig(t *testing.T) {
+	var cfg SinkConfig
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(f)
+
+	if err := f.Parse([]string{
+		"-usage-report.headers=X-A:1",
+		"-usage-report.headers=X-B:2",
+	}); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if cfg.Headers["X-A"] != "1" || cfg.Headers["X-B"] != "2" {
+		t.Fatalf("cfg.Headers = %+v, want X-A:1 and X-B:2", cfg.Headers)
+	}
+}
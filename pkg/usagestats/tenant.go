@@ -0,0 +1,156 @@
+package usagestats
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultReservedTenant is the tenant ID reserved for cluster-wide,
+	// non-tenant-attributable aggregates, such as index compaction bytes,
+	// recorded under it via RecordTenantActivity - following the convention
+	// of reserving an internal tenant ID. tenantSnapshot never folds it into
+	// the "__other" bucket. This package does not reject pushes or queries
+	// under this ID; IsReservedTenant only reports whether a tenant ID
+	// matches it. Operators may override it via Config.ReservedTenant.
+	DefaultReservedTenant = "__loki_cluster"
+
+	// otherTenantBucket collects the long tail of tenants beyond the
+	// configured tenant-cardinality-limit.
+	otherTenantBucket = "__other"
+)
+
+// IsReservedTenant reports whether tenantID is the reserved internal tenant;
+// reserved is normally Config.ReservedTenant. It only reports the match and
+// does not itself reject anything.
+func IsReservedTenant(tenantID, reserved string) bool {
+	return reserved != "" && tenantID == reserved
+}
+
+// TenantActivity is a delta of per-tenant activity passed to
+// RecordTenantActivity.
+type TenantActivity struct {
+	Streams       int64 `json:"streams,omitempty"`
+	Chunks        int64 `json:"chunks,omitempty"`
+	BytesIngested int64 `json:"bytesIngested,omitempty"`
+	Queries       int64 `json:"queries,omitempty"`
+	ActiveSeries  int64 `json:"activeSeries,omitempty"`
+}
+
+func (a *TenantActivity) add(b TenantActivity) {
+	a.Streams += b.Streams
+	a.Chunks += b.Chunks
+	a.BytesIngested += b.BytesIngested
+	a.Queries += b.Queries
+	a.ActiveSeries += b.ActiveSeries
+}
+
+// TenantSummary is the aggregated activity of a tenant over a report
+// window. Count is only set on the collapsed "__other" bucket, where it
+// records how many tenants were folded into it.
+type TenantSummary struct {
+	TenantActivity
+	Count int64 `json:"count,omitempty"`
+}
+
+type tenantRegistry struct {
+	mtx     sync.Mutex
+	tenants map[string]*TenantActivity
+}
+
+var tenantStats = &tenantRegistry{tenants: map[string]*TenantActivity{}}
+
+// RecordTenantActivity accumulates delta against tenantID's running totals
+// for the current report window. It is a no-op when usage reporting is
+// disabled.
+func RecordTenantActivity(tenantID string, delta TenantActivity) {
+	if isDisabled() {
+		return
+	}
+	tenantStats.mtx.Lock()
+	defer tenantStats.mtx.Unlock()
+	a, ok := tenantStats.tenants[tenantID]
+	if !ok {
+		a = &TenantActivity{}
+		tenantStats.tenants[tenantID] = a
+	}
+	a.add(delta)
+}
+
+// tenantSnapshot returns the per-tenant summaries for the current report
+// window without resetting the registry; call resetTenants once the report
+// has actually been sent successfully. When more than limit tenants were
+// active, the tenants with the least BytesIngested are collapsed into a
+// single "__other" bucket so the payload stays bounded on
+// multi-thousand-tenant clusters. A non-positive limit disables collapsing.
+// reserved, the configured Config.ReservedTenant, is always kept out of that
+// collapsed bucket: it carries cluster-wide aggregates rather than real
+// tenant traffic, so its BytesIngested is typically small and would
+// otherwise be sorted into __other ahead of genuine low-volume tenants.
+func tenantSnapshot(limit int, reserved string) map[string]TenantSummary {
+	tenantStats.mtx.Lock()
+	snap := make(map[string]*TenantActivity, len(tenantStats.tenants))
+	for id, a := range tenantStats.tenants {
+		cp := *a
+		snap[id] = &cp
+	}
+	tenantStats.mtx.Unlock()
+
+	if limit <= 0 || len(snap) <= limit {
+		out := make(map[string]TenantSummary, len(snap))
+		for id, a := range snap {
+			out[id] = TenantSummary{TenantActivity: *a}
+		}
+		return out
+	}
+
+	var reservedActivity *TenantActivity
+	if reserved != "" {
+		if a, ok := snap[reserved]; ok {
+			reservedActivity = a
+			delete(snap, reserved)
+		}
+	}
+
+	ids := make([]string, 0, len(snap))
+	for id := range snap {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return snap[ids[i]].BytesIngested > snap[ids[j]].BytesIngested
+	})
+
+	// The reserved tenant still counts against the limit budget, so the
+	// payload size stays bounded, but it's never itself folded into __other.
+	budget := limit
+	if reservedActivity != nil {
+		budget--
+	}
+
+	out := make(map[string]TenantSummary, limit+1)
+	if reservedActivity != nil {
+		out[reserved] = TenantSummary{TenantActivity: *reservedActivity}
+	}
+	other := TenantSummary{}
+	for i, id := range ids {
+		if i < budget {
+			out[id] = TenantSummary{TenantActivity: *snap[id]}
+			continue
+		}
+		other.add(*snap[id])
+		other.Count++
+	}
+	if other.Count > 0 {
+		out[otherTenantBucket] = other
+	}
+	return out
+}
+
+// resetTenants clears the tenant registry so the next report interval
+// starts from zero. It must only be called once a report built from
+// tenantSnapshot has been sent successfully.
+func resetTenants() {
+	tenantStats.mtx.Lock()
+	tenantStats.tenants = map[string]*TenantActivity{}
+	tenantStats.mtx.Unlock()
+}
@@ -0,0 +1,76 @@
+package usagestats
+
+import "testing"
+
+func resetTenantRegistry() {
+	tenantStats.mtx.Lock()
+	tenantStats.tenants = map[string]*TenantActivity{}
+	tenantStats.mtx.Unlock()
+}
+
+func TestTenantSnapshotCollapsesLongTailIntoOther(t *testing.T) {
+	resetTenantRegistry()
+	defer resetTenantRegistry()
+
+	RecordTenantActivity("big", TenantActivity{BytesIngested: 300})
+	RecordTenantActivity("medium", TenantActivity{BytesIngested: 200})
+	RecordTenantActivity("small", TenantActivity{BytesIngested: 100})
+
+	out := tenantSnapshot(2, "")
+
+	if out["big"].BytesIngested != 300 {
+		t.Fatalf("big tenant missing or wrong, got %+v", out)
+	}
+	if out["medium"].BytesIngested != 200 {
+		t.Fatalf("medium tenant missing or wrong, got %+v", out)
+	}
+	if _, ok := out["small"]; ok {
+		t.Fatalf("small tenant should have been collapsed into __other, got %+v", out)
+	}
+	other, ok := out[otherTenantBucket]
+	if !ok || other.BytesIngested != 100 || other.Count != 1 {
+		t.Fatalf("__other bucket = %+v, want BytesIngested=100 Count=1", other)
+	}
+}
+
+func TestTenantSnapshotExemptsReservedTenantFromOther(t *testing.T) {
+	resetTenantRegistry()
+	defer resetTenantRegistry()
+
+	const reserved = "__loki_cluster"
+	// The reserved tenant carries a small cluster-wide aggregate, well below
+	// real tenant traffic, so a naive BytesIngested sort would fold it into
+	// __other ahead of genuine low-volume tenants.
+	RecordTenantActivity(reserved, TenantActivity{BytesIngested: 1})
+	RecordTenantActivity("big", TenantActivity{BytesIngested: 300})
+	RecordTenantActivity("medium", TenantActivity{BytesIngested: 200})
+	RecordTenantActivity("small", TenantActivity{BytesIngested: 100})
+
+	out := tenantSnapshot(2, reserved)
+
+	if out[reserved].BytesIngested != 1 {
+		t.Fatalf("reserved tenant must survive collapsing untouched, got %+v", out)
+	}
+	if out["big"].BytesIngested != 300 {
+		t.Fatalf("big tenant missing or wrong, got %+v", out)
+	}
+	if _, ok := out["medium"]; ok {
+		t.Fatalf("medium tenant should count against the budget once reserved is kept out, got %+v", out)
+	}
+	other, ok := out[otherTenantBucket]
+	if !ok || other.Count != 2 {
+		t.Fatalf("__other bucket = %+v, want Count=2 (medium+small)", other)
+	}
+}
+
+func TestIsReservedTenant(t *testing.T) {
+	if IsReservedTenant("acme", "") {
+		t.Fatal("IsReservedTenant must be false when no reserved tenant is configured")
+	}
+	if !IsReservedTenant("__loki_cluster", "__loki_cluster") {
+		t.Fatal("IsReservedTenant must be true for a matching tenant ID")
+	}
+	if IsReservedTenant("acme", "__loki_cluster") {
+		t.Fatal("IsReservedTenant must be false for a non-matching tenant ID")
+	}
+}